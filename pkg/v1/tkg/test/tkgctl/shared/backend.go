@@ -0,0 +1,85 @@
+// Copyright 2021 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+// nolint:typecheck,goconst,gocritic,stylecheck,nolintlint
+package shared
+
+import (
+	"context"
+	"fmt"
+
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	runtanzuv1alpha3 "github.com/vmware-tanzu/tanzu-framework/apis/run/v1alpha3"
+)
+
+// packageBackendAnnotation selects which PackageBackend verifies the
+// packages declared by a ClusterBootstrap. Mirrors how tkestack annotates
+// clusters with AnywhereSubscriptionNameAnno to select an alternate
+// reconciliation path. When unset, backendCarvel is used.
+const packageBackendAnnotation = "run.tanzu.vmware.com/package-backend"
+
+const (
+	backendCarvel = "carvel"
+	backendHelm   = "helm"
+)
+
+// PackageRef is the resolved identity of a package referenced by a
+// ClusterBootstrap, independent of which backend installed it. Version and
+// Digest are mutually informative, not mutually exclusive: a RefName may
+// resolve a version, a digest, or both.
+type PackageRef struct {
+	ShortName string
+	FQN       string
+	Version   string
+	Digest    string
+}
+
+// PackageBackend resolves a ClusterBootstrap package RefName to a
+// PackageRef and verifies that package is installed and healthy on a
+// target cluster. Implementations exist for the packaging systems that
+// can be selected via packageBackendAnnotation.
+type PackageBackend interface {
+	// Resolve parses refName (as declared in a ClusterBootstrap) into a
+	// PackageRef, preferring the authoritative spec.refName/spec.version of
+	// the matching Package CR on the management cluster mccl when one
+	// exists, and falling back to parsing refName itself otherwise.
+	Resolve(ctx context.Context, mccl client.Client, refName string) (PackageRef, error)
+	// VerifyInstalled blocks until pkg is observed installed and healthy on
+	// clusterName as seen through wccl, or fails the current Gomega
+	// assertion.
+	VerifyInstalled(ctx context.Context, wccl client.Client, clusterName string, pkg PackageRef)
+	// Status performs a single, non-blocking poll of pkg's current
+	// installation status, for callers (such as the worker pool in pool.go)
+	// that want to report a status/condition without waiting for
+	// VerifyInstalled's Eventually loop to converge.
+	Status(ctx context.Context, wccl client.Client, clusterName string, pkg PackageRef) (status, lastCondition string, err error)
+}
+
+// packageBackends is the registry of backends selectable via
+// packageBackendAnnotation.
+//
+// A Clusternet backend was attempted here but dropped: it required
+// vendoring github.com/clusternet/clusternet, a dependency not yet
+// declared anywhere in this module, and shipping that import without the
+// accompanying go.mod/go.sum update would leave the module unbuildable.
+// Re-add it once that dependency has actually been vendored.
+var packageBackends = map[string]PackageBackend{
+	backendCarvel: &carvelPackageBackend{},
+	backendHelm:   &helmPackageBackend{},
+}
+
+// getPackageBackend returns the PackageBackend selected by
+// packageBackendAnnotation on clusterBootstrap, defaulting to the Carvel
+// kapp-controller backend when the annotation is absent.
+func getPackageBackend(clusterBootstrap *runtanzuv1alpha3.ClusterBootstrap) (PackageBackend, error) {
+	name := clusterBootstrap.GetAnnotations()[packageBackendAnnotation]
+	if name == "" {
+		name = backendCarvel
+	}
+	backend, ok := packageBackends[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown package backend %q set via annotation %q", name, packageBackendAnnotation)
+	}
+	return backend, nil
+}
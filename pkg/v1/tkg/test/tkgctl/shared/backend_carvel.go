@@ -0,0 +1,86 @@
+// Copyright 2021 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+// nolint:typecheck,goconst,gocritic,stylecheck,nolintlint
+package shared
+
+import (
+	"context"
+	"strings"
+
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	kappctrl "github.com/vmware-tanzu/carvel-kapp-controller/pkg/apis/kappctrl/v1alpha1"
+	kapppkgiv1alpha1 "github.com/vmware-tanzu/carvel-kapp-controller/pkg/apis/packaging/v1alpha1"
+
+	addonutil "github.com/vmware-tanzu/tanzu-framework/addons/pkg/util"
+	"github.com/vmware-tanzu/tanzu-framework/pkg/v1/tkg/constants"
+	"github.com/vmware-tanzu/tanzu-framework/pkg/v1/tkg/log"
+)
+
+// carvelPackageBackend verifies packages installed via kapp-controller's
+// PackageInstall CR, the default and original ClusterBootstrap backend.
+type carvelPackageBackend struct{}
+
+func (b *carvelPackageBackend) Resolve(ctx context.Context, mccl client.Client, refName string) (PackageRef, error) {
+	return parseCBSRefName(ctx, mccl, refName)
+}
+
+func (b *carvelPackageBackend) VerifyInstalled(ctx context.Context, wccl client.Client, clusterName string, pkg PackageRef) {
+	// packageInstall name for for both management and workload clusters should follow the <cluster name>-<addon short name>
+	pkgiName := addonutil.GeneratePackageInstallName(clusterName, pkg.ShortName)
+	log.Infof("Check PackageInstall %s for package %s of version %s", pkgiName, pkg.FQN, pkg.Version)
+
+	// verify the package is successfully deployed and its name and version (or digest) match with the clusterBootstrap CR
+	pkgInstall := &kapppkgiv1alpha1.PackageInstall{}
+	objKey := client.ObjectKey{Namespace: constants.TkgNamespace, Name: pkgiName}
+	Eventually(func() bool {
+		if err := wccl.Get(ctx, objKey, pkgInstall); err != nil {
+			log.Infof("Get packageinstall error: %s", err.Error())
+			return false
+		}
+		log.Infof("Get PackageInstall, conditions: %d, %+v", len(pkgInstall.Status.GenericStatus.Conditions), pkgInstall.Status.GenericStatus)
+		if len(pkgInstall.Status.GenericStatus.Conditions) == 0 {
+			return false
+		}
+		log.Infof("%+v", pkgInstall.Status.GenericStatus.Conditions[0])
+		log.Infof("%s - %s", pkgInstall.Spec.PackageRef.RefName, pkgInstall.Spec.PackageRef.VersionSelection.Constraints)
+		if pkgInstall.Status.GenericStatus.Conditions[0].Type != kappctrl.ReconcileSucceeded {
+			return false
+		}
+		if pkgInstall.Status.GenericStatus.Conditions[0].Status != corev1.ConditionTrue {
+			return false
+		}
+		if pkgInstall.Spec.PackageRef.RefName != pkg.FQN {
+			return false
+		}
+		return packageInstallMatchesVersionOrDigest(pkgInstall, pkg)
+	}, waitForReadyTimeout, pollingInterval).Should(BeTrue())
+}
+
+// packageInstallMatchesVersionOrDigest reports whether pkgInstall's
+// version selection satisfies pkg, matching on whichever of pkg.Version /
+// pkg.Digest the ClusterBootstrap ref actually carried.
+func packageInstallMatchesVersionOrDigest(pkgInstall *kapppkgiv1alpha1.PackageInstall, pkg PackageRef) bool {
+	constraints := pkgInstall.Spec.PackageRef.VersionSelection.Constraints
+	if pkg.Digest != "" {
+		return strings.Contains(constraints, pkg.Digest)
+	}
+	return constraints == pkg.Version
+}
+
+func (b *carvelPackageBackend) Status(ctx context.Context, wccl client.Client, clusterName string, pkg PackageRef) (string, string, error) {
+	pkgiName := addonutil.GeneratePackageInstallName(clusterName, pkg.ShortName)
+	pkgInstall := &kapppkgiv1alpha1.PackageInstall{}
+	objKey := client.ObjectKey{Namespace: constants.TkgNamespace, Name: pkgiName}
+	if err := wccl.Get(ctx, objKey, pkgInstall); err != nil {
+		return "", "", err
+	}
+	if len(pkgInstall.Status.GenericStatus.Conditions) == 0 {
+		return "Unknown", "", nil
+	}
+	cond := pkgInstall.Status.GenericStatus.Conditions[0]
+	return string(cond.Type), cond.Message, nil
+}
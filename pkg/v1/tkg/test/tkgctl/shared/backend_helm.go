@@ -0,0 +1,86 @@
+// Copyright 2021 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+// nolint:typecheck,goconst,gocritic,stylecheck,nolintlint
+package shared
+
+import (
+	"context"
+	"strconv"
+
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	addonutil "github.com/vmware-tanzu/tanzu-framework/addons/pkg/util"
+	"github.com/vmware-tanzu/tanzu-framework/pkg/v1/tkg/constants"
+	"github.com/vmware-tanzu/tanzu-framework/pkg/v1/tkg/log"
+)
+
+// helmPackageBackend verifies packages installed as plain Helm releases,
+// by reading the release secret Helm's "secrets" storage driver writes to
+// the target cluster (sh.helm.release.v1.<release>.v<revision>).
+type helmPackageBackend struct{}
+
+func (b *helmPackageBackend) Resolve(ctx context.Context, mccl client.Client, refName string) (PackageRef, error) {
+	return parseCBSRefName(ctx, mccl, refName)
+}
+
+func (b *helmPackageBackend) VerifyInstalled(ctx context.Context, wccl client.Client, clusterName string, pkg PackageRef) {
+	releaseName := addonutil.GeneratePackageInstallName(clusterName, pkg.ShortName)
+	log.Infof("Check Helm release %s for package %s of version %s", releaseName, pkg.FQN, pkg.Version)
+
+	Eventually(func() bool {
+		secretList := &corev1.SecretList{}
+		if err := wccl.List(ctx, secretList, client.InNamespace(constants.TkgNamespace), client.MatchingLabels{
+			"owner": "helm",
+			"name":  releaseName,
+		}); err != nil {
+			log.Infof("List helm release secrets error: %s", err.Error())
+			return false
+		}
+		latest := latestHelmReleaseSecret(secretList.Items)
+		if latest == nil {
+			return false
+		}
+		status := latest.Labels["status"]
+		log.Infof("Latest Helm release secret %s has status %q", latest.Name, status)
+		return status == "deployed"
+	}, waitForReadyTimeout, pollingInterval).Should(BeTrue())
+}
+
+func (b *helmPackageBackend) Status(ctx context.Context, wccl client.Client, clusterName string, pkg PackageRef) (string, string, error) {
+	releaseName := addonutil.GeneratePackageInstallName(clusterName, pkg.ShortName)
+	secretList := &corev1.SecretList{}
+	if err := wccl.List(ctx, secretList, client.InNamespace(constants.TkgNamespace), client.MatchingLabels{
+		"owner": "helm",
+		"name":  releaseName,
+	}); err != nil {
+		return "", "", err
+	}
+	latest := latestHelmReleaseSecret(secretList.Items)
+	if latest == nil {
+		return "Unknown", "", nil
+	}
+	return latest.Labels["status"], latest.Name, nil
+}
+
+// latestHelmReleaseSecret returns the release secret with the highest
+// revision label, matching how the Helm "secrets" storage driver encodes
+// release history as one secret per revision. The "version" label is
+// compared numerically, not lexically: revision 10 must sort after 9.
+func latestHelmReleaseSecret(secrets []corev1.Secret) *corev1.Secret {
+	var latest *corev1.Secret
+	var latestRevision int
+	for i := range secrets {
+		revision, err := strconv.Atoi(secrets[i].Labels["version"])
+		if err != nil {
+			continue
+		}
+		if latest == nil || revision > latestRevision {
+			latest = &secrets[i]
+			latestRevision = revision
+		}
+	}
+	return latest
+}
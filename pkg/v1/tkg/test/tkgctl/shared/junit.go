@@ -0,0 +1,92 @@
+// Copyright 2021 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+// nolint:typecheck,goconst,gocritic,stylecheck,nolintlint
+package shared
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/vmware-tanzu/tanzu-framework/pkg/v1/tkg/log"
+)
+
+// junitReportPathEnvVar, when set, tells checkClusterCBS to additionally
+// write a JUnit XML report of its per-package Results to this path so CI
+// can render them as separate test cases.
+const junitReportPathEnvVar = "TKG_PACKAGE_VERIFY_JUNIT_REPORT_PATH"
+
+// writeJUnitReportToPath renders results as a JUnit XML testsuite named
+// after suiteName and writes it to path, logging (rather than failing the
+// spec) if the report can't be written.
+func writeJUnitReportToPath(path, suiteName string, results []Result) {
+	f, err := os.Create(path)
+	if err != nil {
+		log.Infof("Failed to create JUnit report file %q: %s", path, err)
+		return
+	}
+	defer f.Close()
+
+	if err := WriteJUnitReport(f, suiteName, results); err != nil {
+		log.Infof("Failed to write JUnit report to %q: %s", path, err)
+	}
+}
+
+// junitTestSuite and junitTestCase are a minimal JUnit XML representation,
+// enough for CI to render each Result as its own test case instead of one
+// opaque checkClusterCBS failure.
+type junitTestSuite struct {
+	XMLName   xml.Name        `xml:"testsuite"`
+	Name      string          `xml:"name,attr"`
+	Tests     int             `xml:"tests,attr"`
+	Failures  int             `xml:"failures,attr"`
+	TimeSecs  float64         `xml:"time,attr"`
+	TestCases []junitTestCase `xml:"testcase"`
+}
+
+type junitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	TimeSecs  float64       `xml:"time,attr"`
+	Failure   *junitFailure `xml:"failure,omitempty"`
+}
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Body    string `xml:",chardata"`
+}
+
+// WriteJUnitReport renders results as a JUnit XML testsuite named
+// suiteName to w, one testcase per Result.
+func WriteJUnitReport(w io.Writer, suiteName string, results []Result) error {
+	suite := junitTestSuite{Name: suiteName}
+	for _, res := range results {
+		tc := junitTestCase{
+			Name:      res.Name,
+			ClassName: suiteName,
+			TimeSecs:  res.Duration.Seconds(),
+		}
+		if res.Status != packageStatusPassed {
+			tc.Failure = &junitFailure{
+				Message: fmt.Sprintf("package %s did not reach %s: status=%s", res.Name, packageStatusPassed, res.Status),
+				Body:    res.LastCondition,
+			}
+			suite.Failures++
+		}
+		suite.Tests++
+		suite.TimeSecs += tc.TimeSecs
+		suite.TestCases = append(suite.TestCases, tc)
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return fmt.Errorf("failed to write JUnit XML header: %w", err)
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(suite); err != nil {
+		return fmt.Errorf("failed to encode JUnit XML report: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,117 @@
+// Copyright 2021 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+// nolint:typecheck,goconst,gocritic,stylecheck,nolintlint
+package shared
+
+import (
+	"context"
+	"os"
+	"runtime"
+	"strconv"
+	"sync"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/vmware-tanzu/tanzu-framework/pkg/v1/tkg/log"
+)
+
+// packageVerifyWorkersEnvVar overrides the number of packages verified
+// concurrently by verifyPackagesConcurrently; defaults to runtime.NumCPU()
+// when unset or invalid.
+const packageVerifyWorkersEnvVar = "TKG_PACKAGE_VERIFY_WORKERS"
+
+const (
+	packageStatusPassed  = "Passed"
+	packageStatusFailed  = "Failed"
+	packageStatusUnknown = "Unknown"
+)
+
+// Result is the outcome of verifying a single package's installation.
+type Result struct {
+	Name          string
+	Duration      time.Duration
+	Status        string
+	LastCondition string
+}
+
+// ProgressFunc is invoked once per package as soon as its Result is
+// available, so callers can stream progress instead of waiting for every
+// package in the batch to finish.
+type ProgressFunc func(Result)
+
+// packageCheck pairs a resolved PackageRef with the cluster its
+// PackageInstall is expected to live on; checkClusterCBS's remote
+// kapp-controller package, for instance, is verified against the
+// management cluster's naming convention through the workload cluster
+// client, so clusterName can't always be assumed constant across a batch.
+type packageCheck struct {
+	Pkg         PackageRef
+	ClusterName string
+}
+
+func packageVerifyWorkerCount() int {
+	if v := os.Getenv(packageVerifyWorkersEnvVar); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n > 0 {
+			return n
+		}
+	}
+	return runtime.NumCPU()
+}
+
+// verifyPackagesConcurrently verifies every check in checks using backend,
+// bounded to packageVerifyWorkerCount() concurrent checks, and returns one
+// Result per check in the same order as checks. progress, if non-nil, is
+// called once per check as soon as its Result is ready.
+func verifyPackagesConcurrently(ctx context.Context, backend PackageBackend, wccl client.Client, checks []packageCheck, progress ProgressFunc) []Result {
+	results := make([]Result, len(checks))
+	sem := make(chan struct{}, packageVerifyWorkerCount())
+
+	var wg sync.WaitGroup
+	for i, check := range checks {
+		wg.Add(1)
+		go func(i int, check packageCheck) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			res := verifyOnePackage(ctx, backend, wccl, check.ClusterName, check.Pkg)
+			results[i] = res
+			if progress != nil {
+				progress(res)
+			}
+		}(i, check)
+	}
+	wg.Wait()
+
+	return results
+}
+
+// verifyOnePackage runs backend.VerifyInstalled for a single package in
+// its own Ginkgo-recovered goroutine, so a failed Gomega assertion for one
+// package doesn't abort the checks still running for the others, then
+// polls backend.Status once more to capture the condition that explains
+// the outcome.
+func verifyOnePackage(ctx context.Context, backend PackageBackend, wccl client.Client, clusterName string, pkg PackageRef) (result Result) {
+	result = Result{Name: pkg.ShortName}
+	start := time.Now()
+	defer func() {
+		result.Duration = time.Since(start)
+		if status, lastCondition, err := backend.Status(ctx, wccl, clusterName, pkg); err == nil {
+			result.LastCondition = lastCondition
+			if result.Status == "" {
+				result.Status = status
+			}
+		} else if result.Status == "" {
+			result.Status = packageStatusFailed
+		}
+		log.Infof("Package %s verification finished in %s with status %q", pkg.ShortName, result.Duration, result.Status)
+	}()
+	defer GinkgoRecover()
+
+	backend.VerifyInstalled(ctx, wccl, clusterName, pkg)
+	result.Status = packageStatusPassed
+	return
+}
@@ -0,0 +1,133 @@
+// Copyright 2021 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+// Package preflight implements a pluggable registry of cluster readiness
+// checks that run against a management/workload cluster pair before the
+// e2e harness attempts to verify addon installation. It is modeled on
+// Antrea's antctl pre-installation testing framework: each Test reports
+// pass/warn/fail with optional remediation text, and results are
+// aggregated into a Report that can be rendered as JSON or as a
+// human-readable summary.
+package preflight
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"k8s.io/client-go/kubernetes"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	runtanzuv1alpha3 "github.com/vmware-tanzu/tanzu-framework/apis/run/v1alpha3"
+	"github.com/vmware-tanzu/tanzu-framework/pkg/v1/tkg/log"
+)
+
+// Status is the outcome of a single preflight Test.
+type Status string
+
+const (
+	// StatusPass indicates the check found no problem.
+	StatusPass Status = "pass"
+	// StatusWarn indicates the check found a non-fatal issue that may still
+	// cause package installation to fail or degrade.
+	StatusWarn Status = "warn"
+	// StatusFail indicates the check found a problem that will prevent the
+	// target cluster from hosting the packages defined in the ClusterBootstrap.
+	StatusFail Status = "fail"
+)
+
+// Result is the outcome of running a single Test.
+type Result struct {
+	Name        string `json:"name"`
+	Status      Status `json:"status"`
+	Message     string `json:"message"`
+	Remediation string `json:"remediation,omitempty"`
+}
+
+// Config carries the cluster context a Test needs to evaluate readiness.
+type Config struct {
+	MgmtClient     client.Client
+	WorkloadClient client.Client
+	// WorkloadClientset is used by Tests that need APIs a
+	// controller-runtime client.Client doesn't expose, such as streaming
+	// pod logs for the kernel module probe.
+	WorkloadClientset  kubernetes.Interface
+	ClusterBootstrap   *runtanzuv1alpha3.ClusterBootstrap
+	InfrastructureName string
+}
+
+// Test is a single pluggable preflight check.
+type Test interface {
+	// Name uniquely identifies the test in reports.
+	Name() string
+	// Run evaluates the check against cfg and returns its Result.
+	Run(ctx context.Context, cfg Config) Result
+}
+
+// defaultTests is the registry of Tests executed by PreflightCheck.
+var defaultTests []Test
+
+// Register adds t to the set of Tests run by PreflightCheck. It is
+// expected to be called from init() by files in this package that
+// implement concrete checks.
+func Register(t Test) {
+	defaultTests = append(defaultTests, t)
+}
+
+// Report aggregates the Results of every registered Test.
+type Report struct {
+	Results []Result `json:"results"`
+}
+
+// Passed returns true if no Test reported StatusFail.
+func (r *Report) Passed() bool {
+	for _, res := range r.Results {
+		if res.Status == StatusFail {
+			return false
+		}
+	}
+	return true
+}
+
+// JSON renders the report as indented JSON for machine consumption in CI.
+func (r *Report) JSON() ([]byte, error) {
+	return json.MarshalIndent(r, "", "  ")
+}
+
+// Summary renders the report as a human-readable multi-line string.
+func (r *Report) Summary() string {
+	var sb strings.Builder
+	for _, res := range r.Results {
+		fmt.Fprintf(&sb, "[%s] %s: %s", strings.ToUpper(string(res.Status)), res.Name, res.Message)
+		if res.Remediation != "" {
+			fmt.Fprintf(&sb, " (remediation: %s)", res.Remediation)
+		}
+		sb.WriteString("\n")
+	}
+	return sb.String()
+}
+
+// PreflightCheck runs every registered Test against the management cluster
+// client mccl and workload cluster client wccl, for a workload cluster
+// running on infrastructureName (e.g. "vsphere", "aws", "azure"). It
+// returns a Report aggregating every Test's Result; the caller should
+// inspect Report.Passed() before proceeding with package verification.
+func PreflightCheck(ctx context.Context, mccl, wccl client.Client, wcClientset kubernetes.Interface, clusterBootstrap *runtanzuv1alpha3.ClusterBootstrap, infrastructureName string) *Report {
+	cfg := Config{
+		MgmtClient:         mccl,
+		WorkloadClient:     wccl,
+		WorkloadClientset:  wcClientset,
+		ClusterBootstrap:   clusterBootstrap,
+		InfrastructureName: infrastructureName,
+	}
+
+	report := &Report{}
+	for _, t := range defaultTests {
+		log.Infof("Running preflight test %q", t.Name())
+		res := t.Run(ctx, cfg)
+		log.Infof("Preflight test %q completed with status %q: %s", t.Name(), res.Status, res.Message)
+		report.Results = append(report.Results, res)
+	}
+	return report
+}
@@ -0,0 +1,212 @@
+// Copyright 2021 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package preflight
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/vmware-tanzu/tanzu-framework/pkg/v1/tkg/constants"
+)
+
+const (
+	probeNamespace    = constants.TkgNamespace
+	probePollTimeout  = time.Minute * 2
+	probePollInterval = time.Second * 5
+)
+
+// probeDoneMarker is written to a probe pod's log once it has finished
+// attempting every module, so probeKernelModules can tell a completed
+// probe log apart from one that's merely running (the pod itself never
+// exits: see newProbeDaemonSet).
+const probeDoneMarker = "PROBE_DONE"
+
+// probeKernelModules runs a short-lived privileged DaemonSet that attempts
+// to `modprobe` every module in modules on each workload cluster node, and
+// returns the list of modules that could not be loaded on at least one
+// node. The DaemonSet and its pods are deleted before returning.
+func probeKernelModules(ctx context.Context, wccl client.Client, clientset kubernetes.Interface, modules []string) ([]string, error) {
+	name := "tkg-preflight-kernel-module-probe"
+
+	// modprobe has to run against the host's actual module directory, not
+	// the probe image's own, so nsenter into PID 1's mount (and related)
+	// namespaces before invoking it; HostPID+privileged alone only grants
+	// the permission to do that, it doesn't do it implicitly.
+	hostCmd := fmt.Sprintf("for m in %s; do modprobe -n -v \"$m\" || echo \"MISSING:$m\"; done; echo %s",
+		strings.Join(modules, " "), probeDoneMarker)
+	probeCmd := fmt.Sprintf("nsenter --target 1 --mount --uts --ipc --net --pid -- /bin/sh -c '%s'; sleep infinity", hostCmd)
+
+	daemonSet := newProbeDaemonSet(name, probeCmd)
+	if err := wccl.Create(ctx, daemonSet); err != nil {
+		return nil, fmt.Errorf("failed to create kernel module probe DaemonSet: %w", err)
+	}
+	defer func() {
+		_ = wccl.Delete(ctx, daemonSet)
+	}()
+
+	// Poll each probed pod's own log for probeDoneMarker rather than the
+	// pod's phase/readiness: the DaemonSet's RestartPolicyAlways container
+	// never exits and is typically marked ContainersReady as soon as its
+	// process starts, well before the modprobe loop finishes.
+	logsByPod := map[string]string{}
+	err := wait.PollImmediate(probePollInterval, probePollTimeout, func() (bool, error) {
+		var podList corev1.PodList
+		if err := wccl.List(ctx, &podList, client.InNamespace(probeNamespace), client.MatchingLabels{"app": name}); err != nil {
+			return false, nil //nolint:nilerr
+		}
+		if len(podList.Items) == 0 {
+			return false, nil
+		}
+		for i := range podList.Items {
+			pod := &podList.Items[i]
+			if pod.Status.Phase != corev1.PodRunning {
+				return false, nil
+			}
+			logs, err := fetchPodLogs(ctx, clientset, pod)
+			if err != nil || !strings.Contains(logs, probeDoneMarker) {
+				return false, nil
+			}
+			logsByPod[pod.Name] = logs
+		}
+		return true, nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("timed out waiting for kernel module probe to complete on every node: %w", err)
+	}
+
+	missingSet := map[string]bool{}
+	for _, logs := range logsByPod {
+		for _, module := range modules {
+			if strings.Contains(logs, "MISSING:"+module) {
+				missingSet[module] = true
+			}
+		}
+	}
+
+	var missing []string
+	for module := range missingSet {
+		missing = append(missing, module)
+	}
+	return missing, nil
+}
+
+// probeImagePull creates a short-lived Pod whose only container is image,
+// and reports an error if the pod cannot reach ImagePullBackOff-free
+// Running/Succeeded state within probePollTimeout.
+func probeImagePull(ctx context.Context, wccl client.Client, image string) error {
+	name := "tkg-preflight-image-pull-" + sanitizeName(image)
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: probeNamespace,
+			Labels:    map[string]string{"app": name},
+		},
+		Spec: corev1.PodSpec{
+			RestartPolicy: corev1.RestartPolicyNever,
+			Containers: []corev1.Container{
+				{
+					Name:    "probe",
+					Image:   image,
+					Command: []string{"/bin/true"},
+				},
+			},
+		},
+	}
+	if err := wccl.Create(ctx, pod); err != nil {
+		return fmt.Errorf("failed to create image pull probe pod: %w", err)
+	}
+	defer func() {
+		_ = wccl.Delete(ctx, pod)
+	}()
+
+	return wait.PollImmediate(probePollInterval, probePollTimeout, func() (bool, error) {
+		if err := wccl.Get(ctx, client.ObjectKeyFromObject(pod), pod); err != nil {
+			return false, nil //nolint:nilerr
+		}
+		for _, cs := range pod.Status.ContainerStatuses {
+			if cs.State.Waiting != nil && (cs.State.Waiting.Reason == "ImagePullBackOff" || cs.State.Waiting.Reason == "ErrImagePull") {
+				return false, fmt.Errorf("image %q failed to pull: %s", image, cs.State.Waiting.Message)
+			}
+		}
+		return pod.Status.Phase == corev1.PodRunning || pod.Status.Phase == corev1.PodSucceeded, nil
+	})
+}
+
+// newProbeDaemonSet builds the DaemonSet that runs probeCmd on every
+// workload cluster node, including control-plane nodes, so the kernel
+// module check covers the whole cluster rather than whichever single node
+// a Pod would otherwise land on. probeCmd is expected to nsenter into the
+// host namespaces itself (see probeKernelModules) rather than relying on
+// any entrypoint behavior of the probe image.
+func newProbeDaemonSet(name, probeCmd string) *appsv1.DaemonSet {
+	privileged := true
+	labels := map[string]string{"app": name}
+	return &appsv1.DaemonSet{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: probeNamespace,
+			Labels:    labels,
+		},
+		Spec: appsv1.DaemonSetSpec{
+			Selector: &metav1.LabelSelector{MatchLabels: labels},
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{Labels: labels},
+				Spec: corev1.PodSpec{
+					HostPID: true,
+					// DaemonSet pod templates require RestartPolicyAlways;
+					// probeCmd sleeps forever after running its checks so
+					// the container doesn't get restarted mid-probe.
+					RestartPolicy: corev1.RestartPolicyAlways,
+					Tolerations: []corev1.Toleration{
+						{Operator: corev1.TolerationOpExists},
+					},
+					Containers: []corev1.Container{
+						{
+							Name:    "probe",
+							Image:   "projects.registry.vmware.com/tkg/utils/nsenter:v1",
+							Command: []string{"/bin/sh", "-c", probeCmd},
+							SecurityContext: &corev1.SecurityContext{
+								Privileged: &privileged,
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+// fetchPodLogs reads the complete log output of pod's "probe" container.
+func fetchPodLogs(ctx context.Context, clientset kubernetes.Interface, pod *corev1.Pod) (string, error) {
+	stream, err := clientset.CoreV1().Pods(pod.Namespace).GetLogs(pod.Name, &corev1.PodLogOptions{Container: "probe"}).Stream(ctx)
+	if err != nil {
+		return "", fmt.Errorf("failed to open log stream for pod %s/%s: %w", pod.Namespace, pod.Name, err)
+	}
+	defer stream.Close()
+
+	logs, err := io.ReadAll(stream)
+	if err != nil {
+		return "", fmt.Errorf("failed to read logs for pod %s/%s: %w", pod.Namespace, pod.Name, err)
+	}
+	return string(logs), nil
+}
+
+func sanitizeName(image string) string {
+	replacer := strings.NewReplacer("/", "-", ":", "-", "@", "-", ".", "-")
+	name := replacer.Replace(image)
+	if len(name) > 40 {
+		name = name[len(name)-40:]
+	}
+	return strings.Trim(name, "-")
+}
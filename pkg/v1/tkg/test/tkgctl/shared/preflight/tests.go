@@ -0,0 +1,237 @@
+// Copyright 2021 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package preflight
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/Masterminds/semver/v3"
+	corev1 "k8s.io/api/core/v1"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	kapppkgv1alpha1 "github.com/vmware-tanzu/carvel-kapp-controller/pkg/apis/packaging/v1alpha1"
+	runtanzuv1alpha3 "github.com/vmware-tanzu/tanzu-framework/apis/run/v1alpha3"
+	"github.com/vmware-tanzu/tanzu-framework/pkg/v1/tkg/constants"
+)
+
+func init() {
+	Register(&kubernetesVersionTest{})
+	Register(&controlPlaneReadyTest{})
+	Register(&kernelModuleTest{})
+	Register(&vsphereCRDTest{})
+	Register(&imagePullTest{})
+}
+
+// kubernetesVersionTest checks that each package referenced by the
+// ClusterBootstrap declares a well-formed spec.kubernetesVersionSelection
+// constraint, so a malformed selector fails fast in preflight rather than
+// surfacing as an opaque PackageInstall reconcile error later. Packages
+// without a Package CR or without a constraint are skipped. The constraints
+// are only parsed; they are not checked against the workload cluster's
+// Kubernetes version.
+type kubernetesVersionTest struct{}
+
+func (t *kubernetesVersionTest) Name() string { return "kubernetes-version" }
+
+func (t *kubernetesVersionTest) Run(ctx context.Context, cfg Config) Result {
+	for _, refName := range collectRefNames(cfg.ClusterBootstrap) {
+		pkg := &kapppkgv1alpha1.Package{}
+		if err := cfg.MgmtClient.Get(ctx, client.ObjectKey{Name: refName, Namespace: constants.TkgNamespace}, pkg); err != nil {
+			if apierrors.IsNotFound(err) {
+				continue
+			}
+			return Result{Name: t.Name(), Status: StatusWarn, Message: fmt.Sprintf("unable to look up Package %q: %s", refName, err)}
+		}
+		if pkg.Spec.KubernetesVersionSelection == nil || pkg.Spec.KubernetesVersionSelection.Constraints == "" {
+			continue
+		}
+		if _, err := semver.NewConstraint(pkg.Spec.KubernetesVersionSelection.Constraints); err != nil {
+			return Result{
+				Name:        t.Name(),
+				Status:      StatusFail,
+				Message:     fmt.Sprintf("Package %q has an invalid kubernetesVersionSelection constraint %q: %s", refName, pkg.Spec.KubernetesVersionSelection.Constraints, err),
+				Remediation: "fix the kubernetesVersionSelection constraint on the Package CR or pick a different package version",
+			}
+		}
+	}
+	return Result{Name: t.Name(), Status: StatusPass, Message: "every declared kubernetesVersionSelection constraint is well-formed"}
+}
+
+// controlPlaneReadyTest checks that the workload cluster has at least one
+// ready control-plane node before addon installation is attempted.
+type controlPlaneReadyTest struct{}
+
+func (t *controlPlaneReadyTest) Name() string { return "control-plane-ready" }
+
+func (t *controlPlaneReadyTest) Run(ctx context.Context, cfg Config) Result {
+	nodeList := &corev1.NodeList{}
+	if err := cfg.WorkloadClient.List(ctx, nodeList, client.MatchingLabels{"node-role.kubernetes.io/control-plane": ""}); err != nil {
+		return Result{Name: t.Name(), Status: StatusFail, Message: fmt.Sprintf("unable to list control-plane nodes: %s", err)}
+	}
+	readyCount := 0
+	for i := range nodeList.Items {
+		if nodeIsReady(&nodeList.Items[i]) {
+			readyCount++
+		}
+	}
+	if readyCount == 0 {
+		return Result{
+			Name:        t.Name(),
+			Status:      StatusFail,
+			Message:     fmt.Sprintf("found %d control-plane node(s), none Ready", len(nodeList.Items)),
+			Remediation: "wait for the workload cluster's control-plane Machines to finish bootstrapping",
+		}
+	}
+	return Result{Name: t.Name(), Status: StatusPass, Message: fmt.Sprintf("%d/%d control-plane node(s) Ready", readyCount, len(nodeList.Items))}
+}
+
+func nodeIsReady(node *corev1.Node) bool {
+	for _, cond := range node.Status.Conditions {
+		if cond.Type == corev1.NodeReady {
+			return cond.Status == corev1.ConditionTrue
+		}
+	}
+	return false
+}
+
+// cniKernelModules maps a CNI package short name to the kernel modules it
+// requires to be loadable on every workload cluster node.
+var cniKernelModules = map[string][]string{
+	"antrea": {"openvswitch", "br_netfilter"},
+	"calico": {"br_netfilter"},
+	"cilium": {"br_netfilter"},
+}
+
+// kernelModuleTest checks that the kernel modules required by the
+// ClusterBootstrap's selected CNI are loadable on every workload cluster
+// node, via a short-lived privileged DaemonSet probe.
+type kernelModuleTest struct{}
+
+func (t *kernelModuleTest) Name() string { return "cni-kernel-modules" }
+
+func (t *kernelModuleTest) Run(ctx context.Context, cfg Config) Result {
+	if cfg.ClusterBootstrap == nil || cfg.ClusterBootstrap.Spec.CNI == nil {
+		return Result{Name: t.Name(), Status: StatusWarn, Message: "ClusterBootstrap does not declare a CNI package; skipping"}
+	}
+	cniShortName := pkgShortNameFromRef(cfg.ClusterBootstrap.Spec.CNI.RefName)
+	modules := cniKernelModules[cniShortName]
+	if len(modules) == 0 {
+		return Result{Name: t.Name(), Status: StatusPass, Message: fmt.Sprintf("no required kernel modules known for CNI %q", cniShortName)}
+	}
+
+	missing, err := probeKernelModules(ctx, cfg.WorkloadClient, cfg.WorkloadClientset, modules)
+	if err != nil {
+		return Result{Name: t.Name(), Status: StatusWarn, Message: fmt.Sprintf("kernel module probe did not complete: %s", err)}
+	}
+	if len(missing) > 0 {
+		return Result{
+			Name:        t.Name(),
+			Status:      StatusFail,
+			Message:     fmt.Sprintf("node(s) missing required kernel module(s) for %s: %v", cniShortName, missing),
+			Remediation: fmt.Sprintf("load %v on every workload cluster node (e.g. via a DaemonSet or node image customization)", modules),
+		}
+	}
+	return Result{Name: t.Name(), Status: StatusPass, Message: fmt.Sprintf("required kernel module(s) %v present on all probed nodes", modules)}
+}
+
+// vsphereRequiredCRDs are the CRDs the vsphere-csi and vsphere-cpi
+// packages must have registered before they can be installed.
+var vsphereRequiredCRDs = []string{
+	"cnscsisvfeaturestates.cns.vmware.com",
+	"csinodetopologies.cns.vmware.com",
+}
+
+// vsphereCRDTest checks that the vSphere CSI/CPI CRDs are registered on
+// the management cluster when the workload cluster runs on vSphere.
+type vsphereCRDTest struct{}
+
+func (t *vsphereCRDTest) Name() string { return "vsphere-csi-cpi-crds" }
+
+func (t *vsphereCRDTest) Run(ctx context.Context, cfg Config) Result {
+	if cfg.InfrastructureName != "vsphere" {
+		return Result{Name: t.Name(), Status: StatusPass, Message: "infrastructure is not vSphere; skipping"}
+	}
+
+	var missing []string
+	for _, crdName := range vsphereRequiredCRDs {
+		crd := &apiextensionsv1.CustomResourceDefinition{}
+		if err := cfg.MgmtClient.Get(ctx, client.ObjectKey{Name: crdName}, crd); err != nil {
+			missing = append(missing, crdName)
+		}
+	}
+	if len(missing) > 0 {
+		return Result{
+			Name:        t.Name(),
+			Status:      StatusFail,
+			Message:     fmt.Sprintf("missing vSphere CSI/CPI CRD(s): %v", missing),
+			Remediation: "install the vsphere-csi and vsphere-cpi packages before running addon verification",
+		}
+	}
+	return Result{Name: t.Name(), Status: StatusPass, Message: "all required vSphere CSI/CPI CRDs present"}
+}
+
+// imagePullTest checks that the OCI ref for every PackageInstall declared
+// by the ClusterBootstrap is reachable from the workload cluster.
+type imagePullTest struct{}
+
+func (t *imagePullTest) Name() string { return "image-pull-reachability" }
+
+func (t *imagePullTest) Run(ctx context.Context, cfg Config) Result {
+	var unreachable []string
+	for _, refName := range collectRefNames(cfg.ClusterBootstrap) {
+		pkg := &kapppkgv1alpha1.Package{}
+		if err := cfg.MgmtClient.Get(ctx, client.ObjectKey{Name: refName, Namespace: constants.TkgNamespace}, pkg); err != nil {
+			continue
+		}
+		fetch := pkg.Spec.Template.Spec.Fetch
+		if len(fetch) == 0 || fetch[0].ImgpkgBundle == nil {
+			continue
+		}
+		image := fetch[0].ImgpkgBundle.Image
+		if err := probeImagePull(ctx, cfg.WorkloadClient, image); err != nil {
+			unreachable = append(unreachable, image)
+		}
+	}
+	if len(unreachable) > 0 {
+		return Result{
+			Name:        t.Name(),
+			Status:      StatusFail,
+			Message:     fmt.Sprintf("unreachable OCI image ref(s): %v", unreachable),
+			Remediation: "confirm workload cluster nodes can resolve and pull from the configured package repository registry",
+		}
+	}
+	return Result{Name: t.Name(), Status: StatusPass, Message: "verified pull reachability for all referenced package images"}
+}
+
+// collectRefNames gathers every package RefName declared by a
+// ClusterBootstrap: CNI, Kapp, CSI, CPI, and AdditionalPackages.
+func collectRefNames(cb *runtanzuv1alpha3.ClusterBootstrap) []string {
+	if cb == nil {
+		return nil
+	}
+	var refNames []string
+	for _, pkg := range []*runtanzuv1alpha3.ClusterBootstrapPackage{cb.Spec.CNI, cb.Spec.Kapp, cb.Spec.CSI, cb.Spec.CPI} {
+		if pkg != nil {
+			refNames = append(refNames, pkg.RefName)
+		}
+	}
+	for _, pkg := range cb.Spec.AdditionalPackages {
+		if pkg != nil {
+			refNames = append(refNames, pkg.RefName)
+		}
+	}
+	return refNames
+}
+
+func pkgShortNameFromRef(refName string) string {
+	for i, r := range refName {
+		if r == '.' {
+			return refName[:i]
+		}
+	}
+	return refName
+}
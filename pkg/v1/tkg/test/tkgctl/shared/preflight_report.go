@@ -0,0 +1,32 @@
+// Copyright 2021 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+// nolint:typecheck,goconst,gocritic,stylecheck,nolintlint
+package shared
+
+import (
+	"os"
+
+	"github.com/vmware-tanzu/tanzu-framework/pkg/v1/tkg/log"
+	"github.com/vmware-tanzu/tanzu-framework/pkg/v1/tkg/test/tkgctl/shared/preflight"
+)
+
+// preflightReportJSONPathEnvVar, when set, tells checkClusterCBS to
+// additionally write its preflight Report as JSON to this path, so CI can
+// archive the structured result alongside the human-readable Summary()
+// that's always logged.
+const preflightReportJSONPathEnvVar = "TKG_PREFLIGHT_REPORT_JSON_PATH"
+
+// writePreflightJSONReportToPath renders report as JSON and writes it to
+// path, logging (rather than failing the spec) if the report can't be
+// rendered or written.
+func writePreflightJSONReportToPath(path string, report *preflight.Report) {
+	data, err := report.JSON()
+	if err != nil {
+		log.Infof("Failed to render preflight report as JSON: %s", err)
+		return
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		log.Infof("Failed to write preflight JSON report to %q: %s", path, err)
+	}
+}
@@ -0,0 +1,81 @@
+// Copyright 2021 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+// nolint:typecheck,goconst,gocritic,stylecheck,nolintlint
+package shared
+
+import (
+	"context"
+	"regexp"
+	"strings"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	kapppkgv1alpha1 "github.com/vmware-tanzu/carvel-kapp-controller/pkg/apis/packaging/v1alpha1"
+
+	"github.com/vmware-tanzu/tanzu-framework/pkg/v1/tkg/constants"
+)
+
+// semverSuffixRE matches a trailing semver-shaped version (with optional
+// pre-release/build metadata, themselves possibly dot-separated, e.g.
+// "1.11.2+vmware.1-tkg.1") at the end of a package RefName.
+var semverSuffixRE = regexp.MustCompile(`^(.+)\.(v?\d+\.\d+\.\d+(?:-[0-9A-Za-z.-]+)?(?:\+[0-9A-Za-z.-]+)?)$`)
+
+// parseCBSRefName resolves a ClusterBootstrap package RefName to a
+// PackageRef. It first looks up the Package CR named refName on the
+// management cluster, which carries the authoritative spec.refName and
+// spec.version; if no such Package CR exists (e.g. in unit tests, or for
+// a RefName that doesn't name a real Package) it falls back to splitting
+// refName itself. Either path also extracts a trailing "@sha256:<digest>"
+// suffix, should one be present, into PackageRef.Digest.
+func parseCBSRefName(ctx context.Context, mccl client.Client, refName string) (PackageRef, error) {
+	base, digest := splitDigest(refName)
+
+	if mccl != nil {
+		pkg := &kapppkgv1alpha1.Package{}
+		err := mccl.Get(ctx, client.ObjectKey{Name: base, Namespace: constants.TkgNamespace}, pkg)
+		switch {
+		case err == nil:
+			return PackageRef{
+				ShortName: pkgShortName(pkg.Spec.RefName),
+				FQN:       pkg.Spec.RefName,
+				Version:   pkg.Spec.Version,
+				Digest:    digest,
+			}, nil
+		case !apierrors.IsNotFound(err):
+			return PackageRef{}, err
+		}
+	}
+
+	return parseCBSRefNameFallback(base, digest), nil
+}
+
+// parseCBSRefNameFallback splits base on its trailing semver-shaped
+// version suffix, e.g. "antrea.tanzu.vmware.com.1.11.2+vmware.1-tkg.1"
+// into FQN "antrea.tanzu.vmware.com" and Version "1.11.2+vmware.1-tkg.1".
+// If base has no such suffix, the whole string is treated as the FQN with
+// an empty Version, rather than guessing at a split point.
+func parseCBSRefNameFallback(base, digest string) PackageRef {
+	if m := semverSuffixRE.FindStringSubmatch(base); m != nil {
+		return PackageRef{ShortName: pkgShortName(m[1]), FQN: m[1], Version: m[2], Digest: digest}
+	}
+	return PackageRef{ShortName: pkgShortName(base), FQN: base, Digest: digest}
+}
+
+// splitDigest splits off a trailing "@sha256:<hex>" suffix, as used by OCI
+// digest refs, returning the remainder and the digest (without the
+// leading "@").
+func splitDigest(refName string) (string, string) {
+	if i := strings.Index(refName, "@sha256:"); i >= 0 {
+		return refName[:i], refName[i+1:]
+	}
+	return refName, ""
+}
+
+func pkgShortName(fqn string) string {
+	if i := strings.Index(fqn, "."); i >= 0 {
+		return fqn[:i]
+	}
+	return fqn
+}
@@ -0,0 +1,108 @@
+// Copyright 2021 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package shared
+
+import (
+	"context"
+	"testing"
+)
+
+func TestParseCBSRefNameFallback(t *testing.T) {
+	tests := []struct {
+		name      string
+		refName   string
+		wantShort string
+		wantFQN   string
+		wantVer   string
+		wantDig   string
+	}{
+		{
+			name:      "standard four-segment FQN with simple version",
+			refName:   "cert-manager.tanzu.vmware.com.1.5.3",
+			wantShort: "cert-manager",
+			wantFQN:   "cert-manager.tanzu.vmware.com",
+			wantVer:   "1.5.3",
+		},
+		{
+			name:      "version with vmware and tkg build metadata",
+			refName:   "antrea.tanzu.vmware.com.1.11.2+vmware.1-tkg.1",
+			wantShort: "antrea",
+			wantFQN:   "antrea.tanzu.vmware.com",
+			wantVer:   "1.11.2+vmware.1-tkg.1",
+		},
+		{
+			name:      "long hyphenated package name",
+			refName:   "guest-cluster-auth-service.tanzu.vmware.com.1.0.0",
+			wantShort: "guest-cluster-auth-service",
+			wantFQN:   "guest-cluster-auth-service.tanzu.vmware.com",
+			wantVer:   "1.0.0",
+		},
+		{
+			name:      "v-prefixed version",
+			refName:   "calico.tanzu.vmware.com.v3.24.1",
+			wantShort: "calico",
+			wantFQN:   "calico.tanzu.vmware.com",
+			wantVer:   "v3.24.1",
+		},
+		{
+			name:      "no semver suffix at all",
+			refName:   "tkg-storageclass.tanzu.vmware.com",
+			wantShort: "tkg-storageclass",
+			wantFQN:   "tkg-storageclass.tanzu.vmware.com",
+			wantVer:   "",
+		},
+		{
+			name:      "OCI digest ref with no version",
+			refName:   "vsphere-pv-csi.tanzu.vmware.com@sha256:e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855",
+			wantShort: "vsphere-pv-csi",
+			wantFQN:   "vsphere-pv-csi.tanzu.vmware.com",
+			wantVer:   "",
+			wantDig:   "sha256:e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855",
+		},
+		{
+			name:      "OCI digest ref alongside a version",
+			refName:   "antrea.tanzu.vmware.com.1.11.2+vmware.1-tkg.1@sha256:e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855",
+			wantShort: "antrea",
+			wantFQN:   "antrea.tanzu.vmware.com",
+			wantVer:   "1.11.2+vmware.1-tkg.1",
+			wantDig:   "sha256:e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			base, digest := splitDigest(tt.refName)
+			if digest != tt.wantDig {
+				t.Errorf("splitDigest(%q) digest = %q, want %q", tt.refName, digest, tt.wantDig)
+			}
+
+			got := parseCBSRefNameFallback(base, digest)
+			if got.ShortName != tt.wantShort {
+				t.Errorf("ShortName = %q, want %q", got.ShortName, tt.wantShort)
+			}
+			if got.FQN != tt.wantFQN {
+				t.Errorf("FQN = %q, want %q", got.FQN, tt.wantFQN)
+			}
+			if got.Version != tt.wantVer {
+				t.Errorf("Version = %q, want %q", got.Version, tt.wantVer)
+			}
+			if got.Digest != tt.wantDig {
+				t.Errorf("Digest = %q, want %q", got.Digest, tt.wantDig)
+			}
+		})
+	}
+}
+
+func TestParseCBSRefNameWithoutManagementClient(t *testing.T) {
+	// With a nil management cluster client (as in these unit tests),
+	// parseCBSRefName must fall back to parsing refName itself rather than
+	// attempting a Package CR lookup.
+	ref, err := parseCBSRefName(context.Background(), nil, "antrea.tanzu.vmware.com.1.11.2+vmware.1-tkg.1")
+	if err != nil {
+		t.Fatalf("parseCBSRefName returned error: %s", err)
+	}
+	if ref.ShortName != "antrea" || ref.FQN != "antrea.tanzu.vmware.com" || ref.Version != "1.11.2+vmware.1-tkg.1" {
+		t.Errorf("unexpected PackageRef: %+v", ref)
+	}
+}